@@ -0,0 +1,294 @@
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/libyaml"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/templates"
+	"github.com/spf13/afero"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// manifestSourceHeader matches the "# Source: <chart>/templates/foo.yaml"
+// comment helm writes above each document in a rendered manifest, the same
+// marker `helm template --output-dir` uses to decide where each file goes.
+var manifestSourceHeader = regexp.MustCompile(`^# Source: (.+)$`)
+
+// SDKTemplater implements Templater using the Helm Go SDK in-process, rather
+// than forking out to a system `helm` binary. It renders charts the same way
+// `helm template` does, by running a client-only, dry-run install.
+type SDKTemplater struct {
+	Logger         log.Logger
+	FS             afero.Afero
+	BuilderBuilder *templates.BuilderBuilder
+}
+
+func (t *SDKTemplater) Template(
+	chartRoot string,
+	asset api.HelmAsset,
+	meta api.ReleaseMetadata,
+	configGroups []libyaml.ConfigGroup,
+	templateContext map[string]interface{},
+) error {
+	debug := level.Debug(log.With(t.Logger, "step.type", "render", "render.phase", "execute", "asset.type", "helm", "dest", asset.Dest, "description", asset.Description))
+
+	debug.Log("event", "mkdirall.attempt", "dest", asset.Dest)
+	if err := t.FS.MkdirAll(asset.Dest, 0755); err != nil {
+		debug.Log("event", "mkdirall.fail", "err", err, "basePath", asset.Dest)
+		return errors.Wrapf(err, "write directory to %s", asset.Dest)
+	}
+
+	releaseName := strings.ToLower(fmt.Sprintf("%s", meta.ChannelName))
+	releaseName = releaseNameRegex.ReplaceAllLiteralString(releaseName, "-")
+	debug.Log("event", "releasename.resolve", "releasename", releaseName)
+
+	debug.Log("event", "chart.load", "chartRoot", chartRoot)
+	loadedChart, err := loader.Load(chartRoot)
+	if err != nil {
+		return errors.Wrapf(err, "load chart from %s", chartRoot)
+	}
+
+	if err := t.resolveDependencies(chartRoot, loadedChart); err != nil {
+		return errors.Wrap(err, "resolve chart dependencies")
+	}
+
+	actionConfig := new(action.Configuration)
+	client := action.NewInstall(actionConfig)
+	client.ClientOnly = true
+	client.DryRun = true
+	client.ReleaseName = releaseName
+	client.IncludeCRDs = true
+
+	fileValues, err := t.resolveHelmOpts(client, asset.HelmOpts)
+	if err != nil {
+		return errors.Wrap(err, "apply helm opts")
+	}
+
+	setValues, err := t.resolveValues(configGroups, templateContext, asset)
+	if err != nil {
+		return errors.Wrap(err, "resolve helm values")
+	}
+
+	values := mergeValues(fileValues, setValues)
+
+	coalesced, err := chartutil.CoalesceValues(loadedChart, values)
+	if err != nil {
+		return errors.Wrap(err, "coalesce helm values")
+	}
+
+	debug.Log("event", "chart.render")
+	rel, err := client.Run(loadedChart, coalesced)
+	if err != nil {
+		return errors.Wrap(err, "render chart")
+	}
+
+	if err := t.writeManifests(asset.Dest, rel.Manifest); err != nil {
+		return errors.Wrap(err, "write rendered manifests")
+	}
+
+	return nil
+}
+
+func (t *SDKTemplater) resolveDependencies(chartRoot string, loadedChart *chart.Chart) error {
+	debug := level.Debug(log.With(t.Logger, "step.type", "render", "render.phase", "execute", "asset.type", "helm", "render.step", "helm.dependencyUpdate"))
+
+	if len(loadedChart.Metadata.Dependencies) == 0 {
+		debug.Log("event", "dependencies.none")
+		return nil
+	}
+
+	debug.Log("event", "dependencies.update", "chartRoot", chartRoot)
+	man := &downloader.Manager{
+		Out:       ioutil.Discard,
+		ChartPath: chartRoot,
+		Getters:   getter.All(cli.New()),
+	}
+
+	return man.Update()
+}
+
+func (t *SDKTemplater) resolveValues(
+	configGroups []libyaml.ConfigGroup,
+	templateContext map[string]interface{},
+	asset api.HelmAsset,
+) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	configCtx, err := t.BuilderBuilder.NewConfigContext(configGroups, templateContext)
+	if err != nil {
+		return nil, errors.Wrap(err, "create config context")
+	}
+	builder := t.BuilderBuilder.NewBuilder(
+		t.BuilderBuilder.NewStaticContext(),
+		configCtx,
+	)
+
+	for key, value := range asset.Values {
+		renderedValue := value
+		if stringValue, ok := value.(string); ok {
+			renderedValue, err = builder.String(stringValue)
+			if err != nil {
+				return nil, errors.Wrapf(err, "render value for %s", key)
+			}
+		}
+
+		// Parse through strvals the same way ForkTemplater's --set does, so
+		// a dotted/bracketed key like "image.tag" expands into a nested
+		// map instead of landing in values as a literal "image.tag" key
+		// that CoalesceValues won't merge into .Values.image.tag.
+		set := fmt.Sprintf("%s=%v", key, renderedValue)
+		if err := strvals.ParseInto(set, values); err != nil {
+			return nil, errors.Wrapf(err, "parse helm value for %s", key)
+		}
+	}
+
+	return values, nil
+}
+
+// resolveHelmOpts applies the --namespace and --values flags ForkTemplater
+// passes on the command line (built by buildRelease, e.g. --values
+// TempHelmValuesPath/values.yaml) to the install client, and returns the
+// parsed contents of any --values file so it can be merged with
+// asset.Values before coalescing.
+func (t *SDKTemplater) resolveHelmOpts(client *action.Install, opts []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	for i := 0; i < len(opts); i++ {
+		switch opts[i] {
+		case "--namespace":
+			if i+1 >= len(opts) {
+				return nil, errors.New("--namespace given with no value")
+			}
+			client.Namespace = opts[i+1]
+			i++
+		case "--values":
+			if i+1 >= len(opts) {
+				return nil, errors.New("--values given with no path")
+			}
+			valuesPath := opts[i+1]
+			i++
+
+			contents, err := t.FS.ReadFile(valuesPath)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read values file %s", valuesPath)
+			}
+
+			fileValues, err := chartutil.ReadValues(contents)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse values file %s", valuesPath)
+			}
+			values = fileValues
+		}
+	}
+
+	return values, nil
+}
+
+// mergeValues deep-merges override over base, matching the precedence
+// ForkTemplater gets for free from helm's own flag ordering: the --values
+// file is the base, and --set-equivalent asset.Values win on conflict. A
+// shallow merge would let override's nested map for a key replace base's
+// entire nested map for that key, dropping any sibling keys base set there
+// (e.g. base's image.repository lost to override's image.tag); recursing
+// into matching nested maps instead matches what real `helm template -f
+// values.yaml --set ...` does.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range base {
+		merged[k] = v
+	}
+
+	for k, overrideValue := range override {
+		baseValue, exists := merged[k]
+		if !exists {
+			merged[k] = overrideValue
+			continue
+		}
+
+		baseMap, baseIsMap := baseValue.(map[string]interface{})
+		overrideMap, overrideIsMap := overrideValue.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[k] = mergeValues(baseMap, overrideMap)
+			continue
+		}
+
+		merged[k] = overrideValue
+	}
+
+	return merged
+}
+
+// writeManifests splits a rendered manifest back into one file per
+// template, using the "# Source: <path>" header helm writes above each
+// document -- the same layout `helm template --output-dir` produces, which
+// the downstream Kustomize step expects. A single source file that emits
+// more than one document (a NOTES.txt-style range, a helper producing
+// several objects) gets every one of its documents, concatenated in order,
+// not just the last. The "# Source:" header itself is not written to the
+// file; each file holds only the documents' bodies.
+func (t *SDKTemplater) writeManifests(dest string, manifest string) error {
+	// rel.Manifest is built by concatenating each template's "---\n# Source:
+	// ...\n<content>\n" onto an empty buffer, so it begins with a bare
+	// "---\n" rather than "\n---\n". Strip it so the split below doesn't
+	// leave that leading "---" glued to the first document, which would
+	// keep its header from matching manifestSourceHeader and drop it.
+	manifest = strings.TrimPrefix(manifest, "---\n")
+	manifest = strings.TrimPrefix(manifest, "---")
+
+	docs := strings.Split(manifest, "\n---\n")
+
+	order := []string{}
+	bySource := map[string][]string{}
+
+	for _, doc := range docs {
+		doc = strings.TrimSpace(doc)
+		if doc == "" {
+			continue
+		}
+
+		lines := strings.SplitN(doc, "\n", 2)
+		match := manifestSourceHeader.FindStringSubmatch(strings.TrimSpace(lines[0]))
+		if match == nil {
+			continue
+		}
+
+		source := match[1]
+		if _, seen := bySource[source]; !seen {
+			order = append(order, source)
+		}
+
+		body := ""
+		if len(lines) > 1 {
+			body = strings.TrimSpace(lines[1])
+		}
+		bySource[source] = append(bySource[source], body)
+	}
+
+	for _, source := range order {
+		outPath := filepath.Join(dest, source)
+		if err := t.FS.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+			return errors.Wrapf(err, "mkdir %s", filepath.Dir(outPath))
+		}
+
+		contents := strings.Join(bySource[source], "\n---\n") + "\n"
+		if err := t.FS.WriteFile(outPath, []byte(contents), 0644); err != nil {
+			return errors.Wrapf(err, "write %s", outPath)
+		}
+	}
+
+	return nil
+}
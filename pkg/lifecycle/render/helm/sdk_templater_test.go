@@ -0,0 +1,83 @@
+package helm
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestWriteManifests(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     map[string]string
+	}{
+		{
+			name: "first document is kept",
+			manifest: "---\n# Source: chart/templates/a.yaml\ncontent-a\n" +
+				"---\n# Source: chart/templates/b.yaml\ncontent-b\n",
+			want: map[string]string{
+				"chart/templates/a.yaml": "content-a\n",
+				"chart/templates/b.yaml": "content-b\n",
+			},
+		},
+		{
+			name: "multiple documents from the same source are concatenated in order",
+			manifest: "---\n# Source: chart/templates/a.yaml\nfirst\n" +
+				"---\n# Source: chart/templates/a.yaml\nsecond\n",
+			want: map[string]string{
+				"chart/templates/a.yaml": "first\n---\nsecond\n",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			templater := &SDKTemplater{FS: afero.Afero{Fs: afero.NewMemMapFs()}}
+
+			if err := templater.writeManifests("dest", test.manifest); err != nil {
+				t.Fatalf("writeManifests returned error: %v", err)
+			}
+
+			for source, want := range test.want {
+				got, err := templater.FS.ReadFile(filepath.Join("dest", source))
+				if err != nil {
+					t.Fatalf("read %s: %v", source, err)
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", source, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	base := map[string]interface{}{
+		"image": map[string]interface{}{
+			"repository": "nginx",
+		},
+		"replicas": 1,
+	}
+	override := map[string]interface{}{
+		"image": map[string]interface{}{
+			"tag": "1.2.3",
+		},
+	}
+
+	got := mergeValues(base, override)
+
+	want := map[string]interface{}{
+		"image": map[string]interface{}{
+			"repository": "nginx",
+			"tag":        "1.2.3",
+		},
+		"replicas": 1,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeValues(%v, %v) = %v, want %v", base, override, got, want)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/replicatedhq/ship/pkg/api"
 	"github.com/replicatedhq/ship/pkg/templates"
 	"github.com/spf13/afero"
+	"github.com/spf13/viper"
 )
 
 // Templater is something that can consume and render a helm chart pulled by ship.
@@ -240,12 +241,24 @@ func (f *ForkTemplater) helmInitClient(chartRoot string) error {
 	return nil
 }
 
-// NewTemplater returns a configured Templater. For now we just always fork
+// NewTemplater returns a configured Templater. By default we fork out to a
+// system helm binary, but callers that set the `native-helm` config flag get
+// the in-process SDKTemplater instead, which doesn't require helm to be
+// installed on the host.
 func NewTemplater(
 	logger log.Logger,
 	fs afero.Afero,
 	builderBuilder *templates.BuilderBuilder,
+	viper *viper.Viper,
 ) Templater {
+	if viper != nil && viper.GetBool("native-helm") {
+		return &SDKTemplater{
+			Logger:         logger,
+			FS:             fs,
+			BuilderBuilder: builderBuilder,
+		}
+	}
+
 	return &ForkTemplater{
 		Helm: func() *exec.Cmd {
 			return exec.Command("/usr/local/bin/helm")
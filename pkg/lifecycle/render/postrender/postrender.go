@@ -0,0 +1,100 @@
+package postrender
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/plugins"
+	"github.com/spf13/afero"
+)
+
+// renderedManifestsFile is where Execute writes the result of piping the
+// manifests already on disk through every configured PostRenderer, once the
+// per-source files that fed it have been removed.
+const renderedManifestsFile = "post-rendered.yaml"
+
+// PostRender runs every configured plugins.PostRenderer, in order, over the
+// manifests the Render step already wrote to dest, replacing them with the
+// final output. It implements the `PostRender` lifecycle step that
+// buildRelease inserts between Render and Kustomize.
+type PostRender struct {
+	Logger    log.Logger
+	FS        afero.Afero
+	Renderers []plugins.PostRenderer
+}
+
+// Execute reads every manifest under dest, pipes the concatenated result
+// through each PostRenderer, then clears dest and writes only the final
+// manifests back -- so the Kustomize step that runs next, with BasePath
+// dest, sees the post-rendered output instead of a mix of it and the
+// originals it was built from.
+func (p *PostRender) Execute(dest string) error {
+	debug := level.Debug(log.With(p.Logger, "step.type", "render", "render.phase", "execute", "asset.type", "postrender", "dest", dest))
+
+	if len(p.Renderers) == 0 {
+		debug.Log("event", "postrender.none")
+		return nil
+	}
+
+	manifests, err := p.readManifests(dest)
+	if err != nil {
+		return errors.Wrap(err, "read rendered manifests")
+	}
+
+	for i, renderer := range p.Renderers {
+		debug.Log("event", "postrender.run", "hook", i)
+		manifests, err = renderer.Render(manifests)
+		if err != nil {
+			return errors.Wrapf(err, "run post-render hook %d", i)
+		}
+	}
+
+	return p.replaceManifests(dest, manifests)
+}
+
+func (p *PostRender) readManifests(dest string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := afero.Walk(p.FS, dest, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		contents, err := p.FS.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", path)
+		}
+
+		buf.WriteString("---\n")
+		buf.Write(contents)
+		buf.WriteString("\n")
+		return nil
+	})
+
+	return buf.Bytes(), err
+}
+
+// replaceManifests removes every file Render wrote to dest and replaces
+// them with a single renderedManifestsFile holding the post-rendered
+// output, so dest holds only what the hooks actually produced.
+func (p *PostRender) replaceManifests(dest string, manifests []byte) error {
+	entries, err := p.FS.ReadDir(dest)
+	if err != nil {
+		return errors.Wrapf(err, "list %s", dest)
+	}
+
+	for _, entry := range entries {
+		if err := p.FS.RemoveAll(filepath.Join(dest, entry.Name())); err != nil {
+			return errors.Wrapf(err, "remove %s", entry.Name())
+		}
+	}
+
+	return p.FS.WriteFile(filepath.Join(dest, renderedManifestsFile), manifests, 0644)
+}
@@ -0,0 +1,48 @@
+package plugins
+
+import (
+	"bytes"
+	"os/exec"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// ExecPostRenderer implements PostRenderer by spawning an external binary
+// and piping manifests over stdin/stdout, matching Helm 3's
+// `--post-renderer` convention. It's the fallback for platforms where Go
+// plugins aren't available, and for hooks that aren't written in Go.
+type ExecPostRenderer struct {
+	Command func() *exec.Cmd
+	Logger  log.Logger
+}
+
+// NewExecPostRenderer returns a PostRenderer that runs the binary at path,
+// passing args, for every Render call.
+func NewExecPostRenderer(logger log.Logger, path string, args ...string) *ExecPostRenderer {
+	return &ExecPostRenderer{
+		Command: func() *exec.Cmd {
+			return exec.Command(path, args...)
+		},
+		Logger: logger,
+	}
+}
+
+func (e *ExecPostRenderer) Render(manifests []byte) ([]byte, error) {
+	debug := level.Debug(log.With(e.Logger, "step.type", "plugins", "renderer", "exec"))
+
+	cmd := e.Command()
+	cmd.Stdin = bytes.NewReader(manifests)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	debug.Log("event", "cmd.run", "path", cmd.Path)
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Errorf("execute post-renderer %s: %s: stderr: %q", cmd.Path, err.Error(), stderr.String())
+	}
+
+	return stdout.Bytes(), nil
+}
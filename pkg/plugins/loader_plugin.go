@@ -0,0 +1,51 @@
+// +build linux darwin
+
+package plugins
+
+import (
+	"path/filepath"
+	"plugin"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// newPostRendererSymbol is the exported symbol name plugins must provide.
+const newPostRendererSymbol = "NewPostRenderer"
+
+// Load opens every *.so file in dir and collects the PostRenderer each one
+// exports via a `NewPostRenderer` symbol.
+func Load(dir string, logger log.Logger) ([]PostRenderer, error) {
+	debug := level.Debug(log.With(logger, "step.type", "plugins", "dir", dir))
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "glob plugins in %s", dir)
+	}
+
+	var renderers []PostRenderer
+	for _, path := range paths {
+		debug.Log("event", "plugin.open", "path", path)
+
+		p, err := plugin.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open plugin %s", path)
+		}
+
+		sym, err := p.Lookup(newPostRendererSymbol)
+		if err != nil {
+			return nil, errors.Wrapf(err, "lookup %s in plugin %s", newPostRendererSymbol, path)
+		}
+
+		newPostRenderer, ok := sym.(func() PostRenderer)
+		if !ok {
+			return nil, errors.Errorf("plugin %s: %s has the wrong signature, expected func() plugins.PostRenderer", path, newPostRendererSymbol)
+		}
+
+		debug.Log("event", "plugin.loaded", "path", path)
+		renderers = append(renderers, newPostRenderer())
+	}
+
+	return renderers, nil
+}
@@ -0,0 +1,14 @@
+// +build windows
+
+package plugins
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// Load always fails on platforms where the Go plugin package isn't
+// available (notably windows). Use an ExecPostRenderer instead.
+func Load(dir string, logger log.Logger) ([]PostRenderer, error) {
+	return nil, errors.New("loading .so plugins is not supported on this platform, use an exec post-renderer instead")
+}
@@ -0,0 +1,13 @@
+package plugins
+
+// PostRenderer is implemented by anything that transforms rendered
+// manifests before they're handed off to kustomize -- image rewriting,
+// policy injection, SOPS decryption, and so on. It mirrors Helm 3's
+// `--post-renderer` contract.
+type PostRenderer interface {
+	Render(manifests []byte) ([]byte, error)
+}
+
+// NewPostRendererFunc is the symbol a Go plugin must export, named
+// "NewPostRenderer", for it to be discovered by Load.
+type NewPostRendererFunc func() PostRenderer
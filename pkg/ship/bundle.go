@@ -0,0 +1,255 @@
+package ship
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mitchellh/copystructure"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/constants"
+	"gopkg.in/yaml.v2"
+)
+
+// BundleManifest is a helmfile-style description of a set of charts to
+// release together. Releases may depend on one another via `needs`, and
+// `environments` holds named sets of default values applied to every
+// release in that environment.
+type BundleManifest struct {
+	Releases     []BundleRelease               `yaml:"releases"`
+	Environments map[string]BundleEnvironment `yaml:"environments"`
+}
+
+// BundleRelease describes a single chart within a bundle.
+type BundleRelease struct {
+	Name      string                 `yaml:"name"`
+	Chart     string                 `yaml:"chart"`
+	Namespace string                 `yaml:"namespace"`
+	Needs     []string               `yaml:"needs"`
+	Values    map[string]interface{} `yaml:"values"`
+}
+
+// BundleEnvironment holds default values merged under every release when
+// that environment is selected.
+type BundleEnvironment struct {
+	Values map[string]interface{} `yaml:"values"`
+}
+
+func (s *Ship) BundleAndMaybeExit(ctx context.Context) {
+	if err := s.Bundle(ctx); err != nil {
+		s.ExitWithError(err)
+	}
+}
+
+// Bundle reads a helmfile-style manifest from the `bundle-file` flag and
+// renders every release it describes.
+func (s *Ship) Bundle(ctx context.Context) error {
+	debug := level.Debug(log.With(s.Logger, "method", "bundle"))
+
+	if err := s.LoadPlugins(s.Viper.GetString("plugins-dir")); err != nil {
+		return err
+	}
+
+	bundleFile := s.Viper.GetString("bundle-file")
+	debug.Log("event", "read.bundleFile", "path", bundleFile)
+
+	contents, err := ioutil.ReadFile(bundleFile)
+	if err != nil {
+		return errors.Wrapf(err, "read bundle file %s", bundleFile)
+	}
+
+	var manifest BundleManifest
+	if err := yaml.Unmarshal(contents, &manifest); err != nil {
+		return errors.Wrapf(err, "parse bundle file %s", bundleFile)
+	}
+
+	environment := manifest.Environments[s.Viper.GetString("environment")]
+
+	release, err := s.buildBundleRelease(ctx, manifest, environment)
+	if err != nil {
+		return errors.Wrap(err, "build bundle release")
+	}
+
+	return s.execute(ctx, release, nil, true)
+}
+
+// buildBundleRelease resolves every release in the bundle, in dependency
+// order, and assembles one HelmAsset and one Kustomize step per release.
+func (s *Ship) buildBundleRelease(ctx context.Context, manifest BundleManifest, environment BundleEnvironment) (*api.Release, error) {
+	debug := level.Debug(log.With(s.Logger, "method", "buildBundleRelease"))
+
+	ordered, err := sortReleasesByNeeds(manifest.Releases)
+	if err != nil {
+		return nil, errors.Wrap(err, "sort releases")
+	}
+
+	release := &api.Release{
+		Spec: api.Spec{
+			Assets: api.Assets{V1: []api.Asset{}},
+			Lifecycle: api.Lifecycle{
+				V1: []api.Step{
+					{HelmIntro: &api.HelmIntro{}},
+				},
+			},
+		},
+	}
+
+	for _, bundleRelease := range ordered {
+		debug.Log("event", "release.resolve", "release", bundleRelease.Name, "chart", bundleRelease.Chart)
+
+		chartRoot := path.Join(constants.KustomizeHelmPath, bundleRelease.Name)
+
+		chartMetadata, err := s.Resolver.ResolveChartMetadata(ctx, bundleRelease.Chart, chartRoot)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolve chart for release %s", bundleRelease.Name)
+		}
+
+		// Keep the SHA keyed by chart URL, not release name, so Watch can
+		// look it up with the same key it polls ResolveChartMetadata by.
+		s.State.SerializeChartURLForChart(bundleRelease.Name, bundleRelease.Chart)
+		s.State.SerializeContentSHAForChart(bundleRelease.Chart, chartMetadata.ContentSHA)
+
+		values, err := mergeValues(environment.Values, bundleRelease.Values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "merge values for release %s", bundleRelease.Name)
+		}
+
+		destPath := path.Join(constants.RenderedHelmPath, bundleRelease.Name)
+		release.Spec.Assets.V1 = append(release.Spec.Assets.V1, api.Asset{
+			Helm: &api.HelmAsset{
+				AssetShared: api.AssetShared{
+					Dest: destPath,
+				},
+				Local: &api.LocalHelmOpts{
+					ChartRoot: chartRoot,
+				},
+				HelmOpts: []string{"--namespace", bundleRelease.Namespace},
+				Values:   values,
+			},
+		})
+
+		release.Spec.Lifecycle.V1 = append(release.Spec.Lifecycle.V1, api.Step{
+			Render: &api.Render{},
+		}, api.Step{
+			PostRender: &api.PostRender{},
+		}, api.Step{
+			Kustomize: &api.Kustomize{
+				BasePath: destPath,
+				Dest:     path.Join("overlays", "ship", bundleRelease.Name),
+			},
+		})
+	}
+
+	release.Spec.Lifecycle.V1 = append(release.Spec.Lifecycle.V1, api.Step{
+		Message: &api.Message{
+			Contents: `
+Assets are ready to deploy. You can run
+
+    kubectl apply -f installer/rendered
+
+to deploy the overlaid assets to your cluster.
+				`},
+	})
+
+	return release, nil
+}
+
+// sortReleasesByNeeds returns releases in an order where every release
+// appears after everything listed in its `needs`, erroring if the `needs`
+// graph contains a cycle.
+func sortReleasesByNeeds(releases []BundleRelease) ([]BundleRelease, error) {
+	byName := map[string]BundleRelease{}
+	for _, release := range releases {
+		byName[release.Name] = release
+	}
+
+	var ordered []BundleRelease
+	state := map[string]int{} // 0 = unvisited, 1 = in progress, 2 = done
+
+	var visit func(name string, path []string) error
+	visit = func(name string, chain []string) error {
+		switch state[name] {
+		case 2:
+			return nil
+		case 1:
+			return errors.Errorf("cycle detected in release dependencies: %s -> %s", fmt.Sprintf("%v", chain), name)
+		}
+
+		release, ok := byName[name]
+		if !ok {
+			return errors.Errorf("release %s not found, needed by %v", name, chain)
+		}
+
+		state[name] = 1
+		for _, need := range release.Needs {
+			if err := visit(need, append(chain, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, release)
+		return nil
+	}
+
+	for _, release := range releases {
+		if err := visit(release.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// mergeValues deep-merges per-release values over environment defaults,
+// with the release's own values taking precedence.
+func mergeValues(base, override map[string]interface{}) (map[string]interface{}, error) {
+	merged, err := copystructure.Copy(base)
+	if err != nil {
+		return nil, errors.Wrap(err, "copy base values")
+	}
+
+	// copystructure.Copy(nil) returns a nil map, not an empty one, so the
+	// type assertion below succeeds with a nil mergedMap whenever base is
+	// nil or empty (e.g. no environments: block, or --environment doesn't
+	// match a key) -- checking ok alone would miss that and panic writing
+	// into it below.
+	mergedMap, ok := merged.(map[string]interface{})
+	if !ok || mergedMap == nil {
+		mergedMap = map[string]interface{}{}
+	}
+
+	if err := mergestructure(mergedMap, override); err != nil {
+		return nil, err
+	}
+
+	return mergedMap, nil
+}
+
+// mergestructure deep-merges src into dst in place, recursing into nested
+// maps and otherwise letting src win.
+func mergestructure(dst, src map[string]interface{}) error {
+	for key, srcValue := range src {
+		dstValue, exists := dst[key]
+		if !exists {
+			dst[key] = srcValue
+			continue
+		}
+
+		dstMap, dstIsMap := dstValue.(map[string]interface{})
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		if dstIsMap && srcIsMap {
+			if err := mergestructure(dstMap, srcMap); err != nil {
+				return err
+			}
+			continue
+		}
+
+		dst[key] = srcValue
+	}
+
+	return nil
+}
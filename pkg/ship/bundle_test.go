@@ -0,0 +1,82 @@
+package ship
+
+import "testing"
+
+func TestSortReleasesByNeeds(t *testing.T) {
+	releases := []BundleRelease{
+		{Name: "app", Needs: []string{"db", "cache"}},
+		{Name: "db", Needs: []string{"cache"}},
+		{Name: "cache"},
+	}
+
+	ordered, err := sortReleasesByNeeds(releases)
+	if err != nil {
+		t.Fatalf("sortReleasesByNeeds returned error: %v", err)
+	}
+
+	position := map[string]int{}
+	for i, release := range ordered {
+		position[release.Name] = i
+	}
+
+	if position["cache"] > position["db"] {
+		t.Errorf("cache must come before db, got order %v", names(ordered))
+	}
+	if position["db"] > position["app"] {
+		t.Errorf("db must come before app, got order %v", names(ordered))
+	}
+}
+
+func TestSortReleasesByNeedsDetectsCycle(t *testing.T) {
+	releases := []BundleRelease{
+		{Name: "a", Needs: []string{"b"}},
+		{Name: "b", Needs: []string{"c"}},
+		{Name: "c", Needs: []string{"a"}},
+	}
+
+	if _, err := sortReleasesByNeeds(releases); err == nil {
+		t.Fatal("expected an error for a cyclic needs graph, got nil")
+	}
+}
+
+func TestSortReleasesByNeedsUnknownDependency(t *testing.T) {
+	releases := []BundleRelease{
+		{Name: "a", Needs: []string{"missing"}},
+	}
+
+	if _, err := sortReleasesByNeeds(releases); err == nil {
+		t.Fatal("expected an error for a needs reference to a missing release, got nil")
+	}
+}
+
+func TestMergeValuesNilBase(t *testing.T) {
+	// base is nil whenever the selected environment has no values: block at
+	// all -- no environments: defined, or --environment doesn't match a key.
+	merged, err := mergeValues(nil, map[string]interface{}{"replicas": 3})
+	if err != nil {
+		t.Fatalf("mergeValues returned error: %v", err)
+	}
+
+	if merged["replicas"] != 3 {
+		t.Errorf("replicas = %v, want 3", merged["replicas"])
+	}
+}
+
+func TestMergeValuesEmptyBase(t *testing.T) {
+	merged, err := mergeValues(map[string]interface{}{}, map[string]interface{}{"replicas": 3})
+	if err != nil {
+		t.Fatalf("mergeValues returned error: %v", err)
+	}
+
+	if merged["replicas"] != 3 {
+		t.Errorf("replicas = %v, want 3", merged["replicas"])
+	}
+}
+
+func names(releases []BundleRelease) []string {
+	out := make([]string, len(releases))
+	for i, release := range releases {
+		out[i] = release.Name
+	}
+	return out
+}
@@ -3,7 +3,6 @@ package ship
 import (
 	"context"
 	"path"
-	"time"
 
 	"strings"
 
@@ -13,9 +12,57 @@ import (
 	"github.com/replicatedhq/libyaml"
 	"github.com/replicatedhq/ship/pkg/api"
 	"github.com/replicatedhq/ship/pkg/constants"
+	"github.com/replicatedhq/ship/pkg/lifecycle/render/postrender"
+	"github.com/replicatedhq/ship/pkg/plugins"
 	"github.com/replicatedhq/ship/pkg/state"
 )
 
+// LoadPlugins discovers post-render hook plugins in dir and makes them
+// available to buildRelease. It's called from Init, Update, and Watch so
+// that every entry point picks up whatever plugins are installed.
+//
+// If `post-renderer-exec` is set, an ExecPostRenderer running that binary is
+// appended after the Go plugins, for hooks that aren't written in Go or that
+// run on a platform where Go plugins aren't available.
+func (s *Ship) LoadPlugins(dir string) error {
+	debug := level.Debug(log.With(s.Logger, "method", "loadPlugins", "dir", dir))
+
+	var renderers []plugins.PostRenderer
+
+	if dir != "" {
+		debug.Log("event", "plugins.load")
+		loaded, err := plugins.Load(dir, s.Logger)
+		if err != nil {
+			return errors.Wrapf(err, "load plugins from %s", dir)
+		}
+		renderers = append(renderers, loaded...)
+	} else {
+		debug.Log("event", "plugins.dir.unset")
+	}
+
+	if execPath := s.Viper.GetString("post-renderer-exec"); execPath != "" {
+		execArgs := s.Viper.GetStringSlice("post-renderer-exec-args")
+		debug.Log("event", "plugins.exec", "path", execPath)
+		renderers = append(renderers, plugins.NewExecPostRenderer(s.Logger, execPath, execArgs...))
+	}
+
+	s.PostRenderers = renderers
+	return nil
+}
+
+// ExecutePostRender runs every loaded PostRenderer over the manifests the
+// Render step wrote to dest, implementing the PostRender lifecycle step that
+// buildRelease and buildBundleRelease insert between Render and Kustomize.
+func (s *Ship) ExecutePostRender(dest string) error {
+	p := &postrender.PostRender{
+		Logger:    s.Logger,
+		FS:        s.FS,
+		Renderers: s.PostRenderers,
+	}
+
+	return p.Execute(dest)
+}
+
 func (s *Ship) InitAndMaybeExit(ctx context.Context) {
 	if err := s.Init(ctx); err != nil {
 		if err.Error() == constants.ShouldUseUpdate {
@@ -53,6 +100,10 @@ func (s *Ship) stateFileExists(ctx context.Context) bool {
 func (s *Ship) Update(ctx context.Context) error {
 	debug := level.Debug(log.With(s.Logger, "method", "update"))
 
+	if err := s.LoadPlugins(s.Viper.GetString("plugins-dir")); err != nil {
+		return err
+	}
+
 	// does a state file exist on disk?
 	existingState, err := s.State.TryLoad()
 
@@ -68,57 +119,57 @@ func (s *Ship) Update(ctx context.Context) error {
 	}
 
 	debug.Log("event", "fetch latest chart")
-	helmChartMetadata, err := s.Resolver.ResolveChartMetadata(context.Background(), string(helmChartPath))
+	helmChartMetadata, err := s.Resolver.ResolveChartMetadata(context.Background(), string(helmChartPath), constants.KustomizeHelmPath)
 	if err != nil {
 		return errors.Wrapf(err, "resolve helm chart metadata for %s", helmChartPath)
 	}
 
-	release := s.buildRelease(helmChartMetadata)
-
-	return s.execute(ctx, release, nil, true)
-}
-
-func (s *Ship) Watch(ctx context.Context) error {
-	debug := level.Debug(log.With(s.Logger, "method", "watch"))
-
-	for {
-		existingState, err := s.State.TryLoad()
+	if err := s.checkSignerUnchanged(existingState, helmChartMetadata); err != nil {
+		return err
+	}
 
-		if _, noExistingState := existingState.(state.Empty); noExistingState {
-			debug.Log("event", "state.missing")
-			return errors.New(`No state file found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
-		}
+	release, err := s.buildRelease(helmChartMetadata)
+	if err != nil {
+		return err
+	}
 
-		debug.Log("event", "read.chartURL")
-		helmChartPath := existingState.CurrentChartURL()
-		if helmChartPath == "" {
-			return errors.New(`No current chart url found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
-		}
+	s.State.SerializeSignedBy(helmChartMetadata.SignedBy)
 
-		debug.Log("event", "read.lastSHA")
-		lastSHA := existingState.CurrentSHA()
-		if lastSHA == "" {
-			return errors.New(`No current SHA found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
-		}
+	return s.execute(ctx, release, nil, true)
+}
 
-		debug.Log("event", "fetch latest chart")
-		helmChartMetadata, err := s.Resolver.ResolveChartMetadata(context.Background(), string(helmChartPath))
-		if err != nil {
-			return errors.Wrapf(err, "resolve helm chart metadata for %s", helmChartPath)
-		}
+// checkSignerUnchanged rejects a newly resolved chart revision signed by a
+// different key than the one ship update last trusted, unless the user
+// passes --allow-signer-change. It runs after ResolveChartMetadata, so the
+// new revision has already been fetched and unpacked; a rejection stops
+// Update before it renders.
+func (s *Ship) checkSignerUnchanged(existingState state.State, newMetadata api.HelmChartMetadata) error {
+	if !s.Viper.GetBool("verify") {
+		return nil
+	}
 
-		if helmChartMetadata.ContentSHA != existingState.CurrentSHA() {
-			debug.Log("event", "new sha")
-			return nil
-		}
+	lastSignedBy := existingState.CurrentSignedBy()
+	if lastSignedBy == "" || newMetadata.SignedBy == lastSignedBy {
+		return nil
+	}
 
-		time.Sleep(time.Minute * 5) // todo flag
+	if s.Viper.GetBool("allow-signer-change") {
+		return nil
 	}
+
+	return errors.Errorf(
+		"chart was previously signed by %q but the new revision is signed by %q; pass --allow-signer-change to accept this",
+		lastSignedBy, newMetadata.SignedBy,
+	)
 }
 
 func (s *Ship) Init(ctx context.Context) error {
 	debug := level.Debug(log.With(s.Logger, "method", "init"))
 
+	if err := s.LoadPlugins(s.Viper.GetString("plugins-dir")); err != nil {
+		return err
+	}
+
 	if s.Viper.GetString("raw") != "" {
 		release := s.fakeKustomizeRawRelease()
 		return s.execute(ctx, release, nil, true)
@@ -146,7 +197,7 @@ func (s *Ship) Init(ctx context.Context) error {
 	}
 
 	helmChartPath := s.Viper.GetString("chart")
-	helmChartMetadata, err := s.Resolver.ResolveChartMetadata(context.Background(), helmChartPath)
+	helmChartMetadata, err := s.Resolver.ResolveChartMetadata(context.Background(), helmChartPath, constants.KustomizeHelmPath)
 	if err != nil {
 		return errors.Wrapf(err, "resolve helm metadata for %s", helmChartPath)
 	}
@@ -154,9 +205,13 @@ func (s *Ship) Init(ctx context.Context) error {
 	// serialize the ChartURL to disk. First step in creating a state file
 	s.State.SerializeChartURL(helmChartPath)
 
-	release := s.buildRelease(helmChartMetadata)
+	release, err := s.buildRelease(helmChartMetadata)
+	if err != nil {
+		return err
+	}
 
 	s.State.SerializeContentSHA(helmChartMetadata.ContentSHA)
+	s.State.SerializeSignedBy(helmChartMetadata.SignedBy)
 
 	return s.execute(ctx, release, nil, true)
 }
@@ -196,7 +251,10 @@ to deploy the overlaid assets to your cluster.
 	return release
 }
 
-func (s *Ship) buildRelease(helmChartMetadata api.HelmChartMetadata) *api.Release {
+func (s *Ship) buildRelease(helmChartMetadata api.HelmChartMetadata) (*api.Release, error) {
+	if s.Viper.GetBool("verify") && helmChartMetadata.SignedBy == "" {
+		return nil, errors.New("chart signature verification was requested with --verify, but no valid provenance was found")
+	}
 
 	release := &api.Release{
 		Metadata: api.ReleaseMetadata{
@@ -232,6 +290,9 @@ func (s *Ship) buildRelease(helmChartMetadata api.HelmChartMetadata) *api.Releas
 					{
 						Render: &api.Render{},
 					},
+					{
+						PostRender: &api.PostRender{},
+					},
 					{
 						Kustomize: &api.Kustomize{
 							BasePath: constants.RenderedHelmPath,
@@ -253,5 +314,5 @@ to deploy the overlaid assets to your cluster.
 		},
 	}
 
-	return release
+	return release, nil
 }
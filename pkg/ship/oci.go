@@ -0,0 +1,154 @@
+package ship
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	dockerconfig "github.com/docker/cli/cli/config"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"oras.land/oras-go/pkg/content"
+	"oras.land/oras-go/pkg/oras"
+)
+
+// Media types ORAS uses to identify a packaged helm chart artifact and its
+// detached provenance file, matching Helm 3's OCI chart storage convention --
+// both are pushed as layers of the same manifest, under the same tag.
+const (
+	ociChartMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	ociProvMediaType  = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+)
+
+// resolveOCIChart pulls a chart pushed to a Docker-style OCI registry (as
+// `helm push` does) and unpacks it into dest. The artifact digest is used as
+// the ContentSHA so Watch can detect new pushes.
+func (r *Resolver) resolveOCIChart(ctx context.Context, chartPath string, dest string) (api.HelmChartMetadata, error) {
+	debug := level.Debug(log.With(r.Logger, "method", "resolveOCIChart", "chartPath", chartPath, "dest", dest))
+
+	ref := strings.TrimPrefix(chartPath, "oci://")
+
+	resolver, err := r.ociResolver(ctx)
+	if err != nil {
+		return api.HelmChartMetadata{}, errors.Wrap(err, "build oci resolver")
+	}
+
+	verify := r.Viper.GetBool("verify")
+	allowedMediaTypes := []string{ociChartMediaType}
+	if verify {
+		allowedMediaTypes = append(allowedMediaTypes, ociProvMediaType)
+	}
+
+	// ORAS's FileStore only understands real OS paths, so we pull into a
+	// scratch directory on disk and untar the chart layer into r.FS
+	// ourselves, the same way resolveDefaultChart does for go-getter.
+	// Everything downstream (hashDir, the templater) reads exclusively
+	// through r.FS.
+	scratchDir, err := ioutil.TempDir("", "ship-oci")
+	if err != nil {
+		return api.HelmChartMetadata{}, errors.Wrap(err, "create oci scratch dir")
+	}
+	defer os.RemoveAll(scratchDir)
+
+	fileStore := content.NewFileStore(scratchDir)
+	defer fileStore.Close()
+
+	debug.Log("event", "oras.pull", "ref", ref)
+	desc, layers, err := oras.Pull(ctx, resolver, ref, fileStore, oras.WithAllowedMediaTypes(allowedMediaTypes))
+	if err != nil {
+		return api.HelmChartMetadata{}, errors.Wrapf(err, "pull oci chart %s", ref)
+	}
+
+	chartArchivePath, provArchivePath, err := ociLayerPaths(scratchDir, layers)
+	if err != nil {
+		return api.HelmChartMetadata{}, errors.Wrapf(err, "locate pulled layers for %s", ref)
+	}
+
+	debug.Log("event", "untar", "from", chartArchivePath, "to", dest)
+	if err := untarToFS(r.FS, chartArchivePath, dest); err != nil {
+		return api.HelmChartMetadata{}, errors.Wrap(err, "unpack pulled chart")
+	}
+
+	metadata := api.HelmChartMetadata{
+		ContentSHA: desc.Digest.String(),
+	}
+
+	if verify {
+		if provArchivePath == "" {
+			return api.HelmChartMetadata{}, errors.Errorf("--verify was set but %s has no provenance layer", chartPath)
+		}
+
+		digest, signedBy, err := verifyProvenance(chartArchivePath, provArchivePath, r.Viper.GetString("keyring"))
+		if err != nil {
+			return api.HelmChartMetadata{}, errors.Wrapf(err, "verify chart %s", chartPath)
+		}
+		metadata.ProvenanceDigest = digest
+		metadata.SignedBy = signedBy
+	}
+
+	return metadata, nil
+}
+
+// ociLayerPaths maps the descriptors ORAS pulled to the real OS paths
+// content.FileStore wrote them to -- each layer is written under scratchDir
+// named after its "org.opencontainers.image.title" annotation.
+func ociLayerPaths(scratchDir string, layers []ocispec.Descriptor) (chartPath string, provPath string, err error) {
+	for _, layer := range layers {
+		title, ok := layer.Annotations[ocispec.AnnotationTitle]
+		if !ok {
+			continue
+		}
+
+		path := filepath.Join(scratchDir, title)
+		switch layer.MediaType {
+		case ociChartMediaType:
+			chartPath = path
+		case ociProvMediaType:
+			provPath = path
+		}
+	}
+
+	if chartPath == "" {
+		return "", "", errors.New("no chart layer found in pulled artifact")
+	}
+
+	return chartPath, provPath, nil
+}
+
+// ociResolver builds a containerd docker resolver, for ORAS, authenticated
+// against the target registry, preferring an explicit --registry-username/
+// --registry-password pair and falling back to ~/.docker/config.json.
+func (r *Resolver) ociResolver(ctx context.Context) (remotes.Resolver, error) {
+	username := r.Viper.GetString("registry-username")
+	password := r.Viper.GetString("registry-password")
+
+	if username != "" || password != "" {
+		return docker.NewResolver(docker.ResolverOptions{
+			Credentials: func(host string) (string, string, error) {
+				return username, password, nil
+			},
+		}), nil
+	}
+
+	cfg, err := dockerconfig.Load(dockerconfig.Dir())
+	if err != nil {
+		return nil, errors.Wrap(err, "load docker config")
+	}
+
+	return docker.NewResolver(docker.ResolverOptions{
+		Credentials: func(host string) (string, string, error) {
+			authConfig, err := cfg.GetAuthConfig(host)
+			if err != nil {
+				return "", "", errors.Wrapf(err, "get auth config for %s", host)
+			}
+			return authConfig.Username, authConfig.Password, nil
+		},
+	}), nil
+}
@@ -0,0 +1,230 @@
+package ship
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/hashicorp/go-getter"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+)
+
+// Resolver turns a chart reference -- an HTTP(S) URL of a gzipped chart
+// tarball, or an oci:// registry reference -- into the metadata
+// ship needs to render it: where the chart landed on disk, and a content
+// hash used by Watch to detect upstream changes.
+type Resolver struct {
+	Logger log.Logger
+	FS     afero.Afero
+	Viper  *viper.Viper
+}
+
+// ResolveChartMetadata fetches the chart at chartPath, unpacks it into dest,
+// and returns metadata describing what was fetched. Callers that go on to
+// render the chart must pass the same dest as the HelmAsset's ChartRoot --
+// a bundle release gets its own per-release dest so N releases don't
+// overwrite one shared directory. If the `verify` flag is set, the chart's
+// provenance is checked against `keyring` and the result is stamped onto the
+// returned metadata.
+func (r *Resolver) ResolveChartMetadata(ctx context.Context, chartPath string, dest string) (api.HelmChartMetadata, error) {
+	debug := level.Debug(log.With(r.Logger, "method", "resolveChartMetadata", "chartPath", chartPath, "dest", dest))
+
+	if strings.HasPrefix(chartPath, "oci://") {
+		debug.Log("event", "resolve.oci")
+		return r.resolveOCIChart(ctx, chartPath, dest)
+	}
+
+	debug.Log("event", "resolve.default")
+	return r.resolveDefaultChart(ctx, chartPath, dest)
+}
+
+// resolveDefaultChart handles every non-OCI source via go-getter in file
+// mode: the source must be a single gzipped tar archive, such as an HTTP(S)
+// chart tarball or a GitHub release/archive tarball URL. GitHub repositories
+// (including an "owner/repo" shorthand) are not fetched.
+func (r *Resolver) resolveDefaultChart(ctx context.Context, chartPath string, dest string) (api.HelmChartMetadata, error) {
+	debug := level.Debug(log.With(r.Logger, "method", "resolveDefaultChart", "chartPath", chartPath, "dest", dest))
+
+	// go-getter only understands real OS paths, so fetch the packed archive
+	// into a scratch file on disk and untar it into r.FS ourselves --
+	// everything downstream (hashDir, the templater) reads exclusively
+	// through r.FS, and provenance.Verify below needs the packed archive,
+	// not the directory it unpacks into.
+	scratchDir, err := ioutil.TempDir("", "ship-chart")
+	if err != nil {
+		return api.HelmChartMetadata{}, errors.Wrap(err, "create chart scratch dir")
+	}
+	defer os.RemoveAll(scratchDir)
+
+	archivePath := filepath.Join(scratchDir, "chart.tgz")
+	client := &getter.Client{
+		Ctx:  ctx,
+		Src:  chartPath,
+		Dst:  archivePath,
+		Mode: getter.ClientModeFile,
+	}
+
+	debug.Log("event", "getter.get")
+	if err := client.Get(); err != nil {
+		return api.HelmChartMetadata{}, errors.Wrapf(err, "fetch chart %s", chartPath)
+	}
+
+	debug.Log("event", "untar", "from", archivePath, "to", dest)
+	if err := untarToFS(r.FS, archivePath, dest); err != nil {
+		return api.HelmChartMetadata{}, errors.Wrap(err, "unpack fetched chart")
+	}
+
+	contentSHA, err := r.hashDir(dest)
+	if err != nil {
+		return api.HelmChartMetadata{}, errors.Wrap(err, "hash fetched chart")
+	}
+
+	metadata := api.HelmChartMetadata{ContentSHA: contentSHA}
+
+	if r.Viper.GetBool("verify") {
+		digest, signedBy, err := r.verifyArchive(ctx, chartPath, archivePath)
+		if err != nil {
+			return api.HelmChartMetadata{}, errors.Wrapf(err, "verify chart %s", chartPath)
+		}
+		metadata.ProvenanceDigest = digest
+		metadata.SignedBy = signedBy
+	}
+
+	return metadata, nil
+}
+
+// verifyArchive fetches the chart's detached .prov file alongside archivePath
+// and checks it against the configured keyring. It must run before the
+// scratch directory holding archivePath is cleaned up: provenance.Verify
+// hashes the packed archive straight off the real OS filesystem, not
+// through r.FS.
+func (r *Resolver) verifyArchive(ctx context.Context, chartPath, archivePath string) (digest string, signedBy string, err error) {
+	provPath := archivePath + ".prov"
+	provClient := &getter.Client{
+		Ctx:  ctx,
+		Src:  chartPath + ".prov",
+		Dst:  provPath,
+		Mode: getter.ClientModeFile,
+	}
+
+	if err := provClient.Get(); err != nil {
+		return "", "", errors.Wrapf(err, "fetch provenance file for %s", chartPath)
+	}
+
+	return verifyProvenance(archivePath, provPath, r.Viper.GetString("keyring"))
+}
+
+// untarToFS extracts the gzipped tar archive at archivePath (on the real OS
+// filesystem, where go-getter and ORAS write) into dstDir on dstFS, so that
+// everything downstream reads the unpacked chart through the Resolver's
+// injected FS instead of the OS.
+func untarToFS(dstFS afero.Afero, archivePath, dstDir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", archivePath)
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrapf(err, "gunzip %s", archivePath)
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "read tar entries in %s", archivePath)
+		}
+
+		dst := filepath.Join(dstDir, hdr.Name)
+		if !isPathWithinDir(dst, dstDir) {
+			return errors.Errorf("tar entry %s escapes destination directory", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := dstFS.MkdirAll(dst, os.FileMode(hdr.Mode)); err != nil {
+				return errors.Wrapf(err, "mkdir %s", dst)
+			}
+		case tar.TypeReg:
+			if err := dstFS.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return errors.Wrapf(err, "mkdir %s", filepath.Dir(dst))
+			}
+
+			contents, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return errors.Wrapf(err, "read %s", hdr.Name)
+			}
+
+			if err := dstFS.WriteFile(dst, contents, os.FileMode(hdr.Mode)); err != nil {
+				return errors.Wrapf(err, "write %s", dst)
+			}
+		}
+	}
+}
+
+// isPathWithinDir reports whether dst is dir itself or a descendant of it,
+// guarding untarToFS against a Zip Slip entry (a tar header with a "../"
+// path or an absolute path) writing outside the intended destination.
+func isPathWithinDir(dst, dir string) bool {
+	dst = filepath.Clean(dst)
+	dir = filepath.Clean(dir)
+
+	if dst == dir {
+		return true
+	}
+
+	return strings.HasPrefix(dst, dir+string(filepath.Separator))
+}
+
+// hashDir returns a content hash for a directory of fetched chart files,
+// used to detect upstream changes between polls. File paths are hashed
+// relative to dir, so the same chart hashes the same wherever it's unpacked.
+func (r *Resolver) hashDir(dir string) (string, error) {
+	h := sha256.New()
+
+	err := afero.Walk(r.FS, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		contents, err := r.FS.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", path)
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return errors.Wrapf(err, "relativize %s", path)
+		}
+
+		h.Write([]byte(rel))
+		h.Write(contents)
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "walk %s", dir)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
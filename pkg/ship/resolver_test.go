@@ -0,0 +1,90 @@
+package ship
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func writeTestArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", "ship-untar-test")
+	if err != nil {
+		t.Fatalf("create temp archive: %v", err)
+	}
+	defer f.Close()
+
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: int64(len(contents)),
+		}); err != nil {
+			t.Fatalf("write tar header for %s: %v", name, err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatalf("write tar contents for %s: %v", name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("close gzip writer: %v", err)
+	}
+
+	return f.Name()
+}
+
+func TestUntarToFS(t *testing.T) {
+	archivePath := writeTestArchive(t, map[string]string{
+		"chart/Chart.yaml":            "name: test\n",
+		"chart/templates/deploy.yaml": "kind: Deployment\n",
+	})
+	defer os.Remove(archivePath)
+
+	dstFS := afero.Afero{Fs: afero.NewMemMapFs()}
+	if err := untarToFS(dstFS, archivePath, "dest"); err != nil {
+		t.Fatalf("untarToFS returned error: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"chart/Chart.yaml":            "name: test\n",
+		"chart/templates/deploy.yaml": "kind: Deployment\n",
+	} {
+		got, err := dstFS.ReadFile(filepath.Join("dest", name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestUntarToFSRejectsPathEscape(t *testing.T) {
+	archivePath := writeTestArchive(t, map[string]string{
+		"../../../../etc/passwd": "pwned\n",
+	})
+	defer os.Remove(archivePath)
+
+	dstFS := afero.Afero{Fs: afero.NewMemMapFs()}
+	err := untarToFS(dstFS, archivePath, "dest")
+	if err == nil {
+		t.Fatal("expected an error for a tar entry escaping the destination directory, got nil")
+	}
+
+	if ok, _ := dstFS.Exists("etc/passwd"); ok {
+		t.Error("untarToFS wrote outside the destination directory")
+	}
+}
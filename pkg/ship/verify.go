@@ -0,0 +1,45 @@
+package ship
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// verifyProvenance checks a chart's detached .prov file against keyringPath,
+// mirroring Helm's provenance model, and returns the artifact digest and the
+// identity of the signer.
+func verifyProvenance(chartPath, provPath, keyringPath string) (digest string, signedBy string, err error) {
+	if keyringPath == "" {
+		return "", "", errors.New("--verify was set but no --keyring was given")
+	}
+
+	sig, err := provenance.NewFromKeyring(keyringPath, "")
+	if err != nil {
+		return "", "", errors.Wrapf(err, "load keyring %s", keyringPath)
+	}
+
+	verification, err := sig.Verify(chartPath, provPath)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "verify provenance for %s", chartPath)
+	}
+
+	// Identities is a map, so range order is randomized per process. Sort
+	// the UIDs and take the first so the recorded signedBy is stable across
+	// runs -- checkSignerUnchanged compares this value verbatim to detect a
+	// re-pull signed by a different key, and a flapping value here would
+	// make that comparison unreliable for any key with more than one UID.
+	names := make([]string, 0, len(verification.SignedBy.Identities))
+	for name := range verification.SignedBy.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var identity string
+	if len(names) > 0 {
+		identity = verification.SignedBy.Identities[names[0]].Name
+	}
+
+	return verification.FileHash, identity, nil
+}
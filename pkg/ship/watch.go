@@ -0,0 +1,268 @@
+package ship
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/ship/pkg/api"
+	"github.com/replicatedhq/ship/pkg/state"
+)
+
+const (
+	defaultWatchInterval   = time.Minute * 5
+	defaultWatchMaxBackoff = time.Minute * 30
+)
+
+// WatchEvent is emitted on the channel returned by WatchC.
+type WatchEvent interface {
+	isWatchEvent()
+}
+
+// ChartUpdated is emitted when a poll finds a chart whose content no longer
+// matches the last known SHA.
+type ChartUpdated struct {
+	OldSHA   string
+	NewSHA   string
+	Metadata api.HelmChartMetadata
+}
+
+// PollError is emitted when a poll fails to resolve chart metadata. The
+// watcher keeps running and retries with exponential backoff.
+type PollError struct {
+	Err error
+}
+
+// Stopped is emitted by each chart's watch loop when it exits because its
+// context was canceled, so a watch over N charts emits N Stopped events
+// before the event channel is closed.
+type Stopped struct{}
+
+func (ChartUpdated) isWatchEvent() {}
+func (PollError) isWatchEvent()    {}
+func (Stopped) isWatchEvent()      {}
+
+// Watch polls for chart updates and returns as soon as one is found, the way
+// `ship watch` has always behaved. It's a thin blocking wrapper around
+// WatchC for callers that just want a single update.
+func (s *Ship) Watch(ctx context.Context) error {
+	if err := s.LoadPlugins(s.Viper.GetString("plugins-dir")); err != nil {
+		return err
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := s.WatchC(watchCtx)
+	if err != nil {
+		return err
+	}
+
+	for event := range events {
+		switch e := event.(type) {
+		case ChartUpdated:
+			cancel()
+		case Stopped:
+			cancel()
+		case PollError:
+			_ = e // already logged by the watch loop; Watch just keeps waiting
+		}
+	}
+
+	return nil
+}
+
+// WatchC starts polling every chart recorded in the current state file --
+// one, for a release created by Init/Update, or one per release for a
+// bundle created by Bundle -- and returns a single channel of WatchEvents
+// fed by all of them, so ship returns as soon as any one chart changes.
+func (s *Ship) WatchC(ctx context.Context) (<-chan WatchEvent, error) {
+	debug := level.Debug(log.With(s.Logger, "method", "watchC"))
+
+	existingState, err := s.State.TryLoad()
+	if _, noExistingState := existingState.(state.Empty); noExistingState {
+		debug.Log("event", "state.missing")
+		return nil, errors.New(`No state file found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
+	}
+
+	charts, err := s.chartsToWatch(existingState)
+	if err != nil {
+		return nil, err
+	}
+
+	// Register every chart URL before starting any watch-loop goroutine. If
+	// a later registration fails (e.g. a concurrent WatchC call is already
+	// watching one of these charts), unregister everything registered so
+	// far and bail out without having started a single goroutine --
+	// starting some and then returning early would leak them, since nothing
+	// would be left to call wg.Wait()/close(events) and their first
+	// unbuffered send on events would block forever.
+	registered := make([]string, 0, len(charts))
+	for chartURL := range charts {
+		if err := s.registerWatcher(chartURL); err != nil {
+			for _, registeredURL := range registered {
+				s.unregisterWatcher(registeredURL)
+			}
+			return nil, err
+		}
+		registered = append(registered, chartURL)
+	}
+
+	events := make(chan WatchEvent)
+	var wg sync.WaitGroup
+
+	for chartURL, lastSHA := range charts {
+		wg.Add(1)
+		go func(chartURL, lastSHA string) {
+			defer wg.Done()
+			s.watchLoop(ctx, chartURL, lastSHA, events)
+		}(chartURL, lastSHA)
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events, nil
+}
+
+// chartsToWatch returns the chart URLs to poll, and the last known SHA for
+// each. A bundle release (CurrentChartURLs) tracks one entry per release;
+// a single-chart release (CurrentChartURL) tracks exactly one.
+func (s *Ship) chartsToWatch(existingState state.State) (map[string]string, error) {
+	debug := level.Debug(log.With(s.Logger, "method", "chartsToWatch"))
+
+	if bundleURLs := existingState.CurrentChartURLs(); len(bundleURLs) > 0 {
+		debug.Log("event", "read.bundleChartURLs", "count", len(bundleURLs))
+		shas := existingState.CurrentSHAs()
+
+		charts := map[string]string{}
+		for _, chartURL := range bundleURLs {
+			charts[chartURL] = shas[chartURL]
+		}
+		return charts, nil
+	}
+
+	debug.Log("event", "read.chartURL")
+	chartURL := string(existingState.CurrentChartURL())
+	if chartURL == "" {
+		return nil, errors.New(`No current chart url found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
+	}
+
+	debug.Log("event", "read.lastSHA")
+	lastSHA := existingState.CurrentSHA()
+	if lastSHA == "" {
+		return nil, errors.New(`No current SHA found at ` + s.Viper.GetString("state-file") + `, please run "ship init"`)
+	}
+
+	return map[string]string{chartURL: lastSHA}, nil
+}
+
+func (s *Ship) watchLoop(ctx context.Context, chartURL string, lastSHA string, events chan<- WatchEvent) {
+	debug := level.Debug(log.With(s.Logger, "method", "watchLoop", "chartURL", chartURL))
+	defer s.unregisterWatcher(chartURL)
+
+	interval := s.Viper.GetDuration("watch-interval")
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	maxBackoff := s.Viper.GetDuration("watch-max-backoff")
+	if maxBackoff <= 0 {
+		maxBackoff = defaultWatchMaxBackoff
+	}
+
+	backoff := interval
+
+	// watchLoop only re-fetches to detect changes; it never renders, so it
+	// doesn't need the chart's real ChartRoot -- just a stable scratch
+	// directory of its own, since several charts may be polled concurrently.
+	dest := filepath.Join(os.TempDir(), "ship-watch", fmt.Sprintf("%x", sha256.Sum256([]byte(chartURL))))
+
+	for {
+		metadata, err := s.Resolver.ResolveChartMetadata(ctx, chartURL, dest)
+		if err != nil {
+			debug.Log("event", "resolve.fail", "err", err, "backoff", backoff)
+			events <- PollError{Err: errors.Wrapf(err, "resolve helm chart metadata for %s", chartURL)}
+
+			if !sleepOrDone(ctx, backoff) {
+				events <- Stopped{}
+				return
+			}
+
+			backoff = nextBackoff(backoff, maxBackoff)
+			continue
+		}
+
+		backoff = interval
+
+		if metadata.ContentSHA != lastSHA {
+			debug.Log("event", "chart.updated", "oldSHA", lastSHA, "newSHA", metadata.ContentSHA)
+			events <- ChartUpdated{
+				OldSHA:   lastSHA,
+				NewSHA:   metadata.ContentSHA,
+				Metadata: metadata,
+			}
+			lastSHA = metadata.ContentSHA
+		}
+
+		if !sleepOrDone(ctx, interval) {
+			events <- Stopped{}
+			return
+		}
+	}
+}
+
+// nextBackoff doubles d, capping it at max.
+func nextBackoff(d, max time.Duration) time.Duration {
+	d *= 2
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// sleepOrDone waits for d, returning false early if ctx is canceled first.
+func sleepOrDone(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+var watchersMu sync.Mutex
+
+// registerWatcher ensures only one watcher runs per chart URL at a time.
+func (s *Ship) registerWatcher(chartURL string) error {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	if s.watchers == nil {
+		s.watchers = map[string]bool{}
+	}
+
+	if s.watchers[chartURL] {
+		return errors.Errorf("already watching chart %s", chartURL)
+	}
+
+	s.watchers[chartURL] = true
+	return nil
+}
+
+func (s *Ship) unregisterWatcher(chartURL string) {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+	delete(s.watchers, chartURL)
+}
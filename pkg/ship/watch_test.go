@@ -0,0 +1,28 @@
+package ship
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+		max  time.Duration
+		want time.Duration
+	}{
+		{name: "doubles under the cap", d: time.Second, max: time.Minute, want: 2 * time.Second},
+		{name: "caps at max", d: 45 * time.Second, max: time.Minute, want: time.Minute},
+		{name: "stays capped once at max", d: time.Minute, max: time.Minute, want: time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := nextBackoff(test.d, test.max)
+			if got != test.want {
+				t.Errorf("nextBackoff(%v, %v) = %v, want %v", test.d, test.max, got, test.want)
+			}
+		})
+	}
+}